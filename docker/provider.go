@@ -3,16 +3,24 @@ package docker
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
 	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"net/http"
 	"os"
+	"os/exec"
 	"os/user"
+	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/errdefs"
 	"github.com/hashicorp/terraform/helper/schema"
 	"github.com/hashicorp/terraform/terraform"
 )
@@ -54,6 +62,13 @@ func Provider() terraform.ResourceProvider {
 				Description: "Path to directory with Docker TLS config",
 			},
 
+			"registry_auth_validate": &schema.Schema{
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     true,
+				Description: "Validate every registry_auth entry against the daemon's /auth endpoint at configure time",
+			},
+
 			"registry_auth": &schema.Schema{
 				Type:     schema.TypeSet,
 				Optional: true,
@@ -68,7 +83,7 @@ func Provider() terraform.ResourceProvider {
 						"username": &schema.Schema{
 							Type:          schema.TypeString,
 							Optional:      true,
-							ConflictsWith: []string{"registry_auth.config_file"},
+							ConflictsWith: []string{"registry_auth.config_file", "registry_auth.credential_helper"},
 							DefaultFunc:   schema.EnvDefaultFunc("DOCKER_REGISTRY_USER", ""),
 							Description:   "Username for the registry",
 						},
@@ -77,17 +92,80 @@ func Provider() terraform.ResourceProvider {
 							Type:          schema.TypeString,
 							Optional:      true,
 							Sensitive:     true,
-							ConflictsWith: []string{"registry_auth.config_file"},
+							ConflictsWith: []string{"registry_auth.config_file", "registry_auth.identity_token", "registry_auth.registry_token", "registry_auth.credential_helper"},
 							DefaultFunc:   schema.EnvDefaultFunc("DOCKER_REGISTRY_PASS", ""),
 							Description:   "Password for the registry",
 						},
 
+						"identity_token": &schema.Schema{
+							Type:          schema.TypeString,
+							Optional:      true,
+							Sensitive:     true,
+							ConflictsWith: []string{"registry_auth.config_file", "registry_auth.password", "registry_auth.registry_token", "registry_auth.credential_helper"},
+							DefaultFunc:   schema.EnvDefaultFunc("DOCKER_REGISTRY_IDENTITY_TOKEN", ""),
+							Description:   "Identity token to use in place of a password for the registry, usually a refresh token returned from a prior registry login",
+						},
+
+						"registry_token": &schema.Schema{
+							Type:          schema.TypeString,
+							Optional:      true,
+							Sensitive:     true,
+							ConflictsWith: []string{"registry_auth.config_file", "registry_auth.password", "registry_auth.identity_token", "registry_auth.credential_helper"},
+							DefaultFunc:   schema.EnvDefaultFunc("DOCKER_REGISTRY_TOKEN", ""),
+							Description:   "Bearer token to be sent in the X-Registry-Auth header, bypassing the engine's /auth endpoint entirely",
+						},
+
 						"config_file": &schema.Schema{
 							Type:          schema.TypeString,
 							Optional:      true,
-							ConflictsWith: []string{"registry_auth.username", "registry_auth.password"},
-							DefaultFunc:   schema.EnvDefaultFunc("DOCKER_CONFIG", "~/.docker/config.json"),
-							Description:   "Path to docker json file for registry auth",
+							ConflictsWith: []string{"registry_auth.username", "registry_auth.password", "registry_auth.identity_token", "registry_auth.registry_token", "registry_auth.credential_helper"},
+							DefaultFunc:   schema.EnvDefaultFunc("DOCKER_CONFIG", "~/.docker"),
+							Description:   "Path to a docker config.json file, or to a $DOCKER_CONFIG-style directory containing one, for registry auth",
+						},
+
+						"disable_credential_helpers": &schema.Schema{
+							Type:        schema.TypeBool,
+							Optional:    true,
+							Default:     false,
+							Description: "Don't resolve credsStore/credHelpers entries in the config file, only use inline auths",
+						},
+
+						"credential_helper": &schema.Schema{
+							Type:          schema.TypeList,
+							Optional:      true,
+							MaxItems:      1,
+							ConflictsWith: []string{"registry_auth.username", "registry_auth.password", "registry_auth.identity_token", "registry_auth.registry_token", "registry_auth.config_file"},
+							Description:   "Resolve credentials for this registry by invoking a docker-credential-<name> helper directly, without needing a config.json on disk",
+							Elem: &schema.Resource{
+								Schema: map[string]*schema.Schema{
+									"name": &schema.Schema{
+										Type:        schema.TypeString,
+										Required:    true,
+										Description: "Name of the docker-credential-<name> helper binary, e.g. ecr-login, gcr, acr",
+									},
+
+									"args": &schema.Schema{
+										Type:        schema.TypeList,
+										Optional:    true,
+										Elem:        &schema.Schema{Type: schema.TypeString},
+										Description: "Extra arguments to pass to the credential helper binary",
+									},
+
+									"env": &schema.Schema{
+										Type:        schema.TypeMap,
+										Optional:    true,
+										Elem:        &schema.Schema{Type: schema.TypeString},
+										Description: "Extra environment variables to set when invoking the credential helper binary",
+									},
+
+									"refresh_interval": &schema.Schema{
+										Type:        schema.TypeString,
+										Optional:    true,
+										Default:     "0s",
+										Description: "Minimum age after which ProviderConfig.RefreshCredentialHelpers re-invokes the helper, e.g. \"11h\" for ECR tokens that expire after 12h; \"0s\" resolves the credential once at configure time. No resource calls RefreshCredentialHelpers, so pulls and pushes use the credential resolved at configure time",
+									},
+								},
+							},
 						},
 					},
 				},
@@ -121,11 +199,60 @@ func providerConfigure(d *schema.ResourceData) (interface{}, error) {
 		CertPath: d.Get("cert_path").(string),
 	}
 
+	var httpHeaders map[string]string
+
+	// A registry_auth.config_file may itself select a currentContext whose
+	// endpoint/TLS material should drive the provider's own connection, and
+	// may set HttpHeaders to attach to every daemon request. Resolve that
+	// before building the client so both take effect immediately.
+	if v, ok := d.GetOk("registry_auth"); ok {
+		for _, authInt := range v.(*schema.Set).List() {
+			configFile, ok := authInt.(map[string]interface{})["config_file"].(string)
+			if !ok || configFile == "" {
+				continue
+			}
+
+			filePath, confFile, err := resolveDockerConfigFile(configFile)
+			if err != nil {
+				return nil, fmt.Errorf("Error loading docker config file: %s", err)
+			}
+
+			if len(confFile.HttpHeaders) > 0 {
+				httpHeaders = confFile.HttpHeaders
+			}
+
+			if confFile.CurrentContext != "" {
+				endpoint, err := loadDockerContextEndpoint(filepath.Dir(filePath), confFile.CurrentContext)
+				if err != nil {
+					return nil, fmt.Errorf("Error loading docker context %q: %s", confFile.CurrentContext, err)
+				}
+				if endpoint.Host != "" {
+					config.Host = endpoint.Host
+				}
+				if endpoint.Ca != "" {
+					config.Ca = endpoint.Ca
+				}
+				if endpoint.Cert != "" {
+					config.Cert = endpoint.Cert
+				}
+				if endpoint.Key != "" {
+					config.Key = endpoint.Key
+				}
+			}
+
+			break
+		}
+	}
+
 	client, err := config.NewClient()
 	if err != nil {
 		return nil, fmt.Errorf("Error initializing Docker client: %s", err)
 	}
 
+	if len(httpHeaders) > 0 {
+		attachHTTPHeaders(client, httpHeaders)
+	}
+
 	ctx := context.Background()
 	_, err = client.Ping(ctx)
 	if err != nil {
@@ -133,18 +260,26 @@ func providerConfigure(d *schema.ResourceData) (interface{}, error) {
 	}
 
 	authConfigs := &AuthConfigs{}
+	var credentialHelperRefreshers []*CredentialHelperRefresher
 
 	if v, ok := d.GetOk("registry_auth"); ok {
-		authConfigs, err = providerSetToRegistryAuth(v.(*schema.Set))
+		authConfigs, credentialHelperRefreshers, err = providerSetToRegistryAuth(v.(*schema.Set))
 
 		if err != nil {
 			return nil, fmt.Errorf("Error loading registry auth config: %s", err)
 		}
+
+		if d.Get("registry_auth_validate").(bool) {
+			if err := AuthCheck(ctx, client, authConfigs); err != nil {
+				return nil, err
+			}
+		}
 	}
 
 	providerConfig := ProviderConfig{
-		DockerClient: client,
-		AuthConfigs:  authConfigs,
+		DockerClient:               client,
+		AuthConfigs:                authConfigs,
+		CredentialHelperRefreshers: credentialHelperRefreshers,
 	}
 
 	return &providerConfig, nil
@@ -162,44 +297,78 @@ type AuthConfigs struct {
 // dockerConfig represents a registry authentation configuration from the
 // .dockercfg file.
 type dockerConfig struct {
-	Auth  string `json:"auth"`
-	Email string `json:"email"`
+	Auth          string `json:"auth"`
+	Email         string `json:"email"`
+	IdentityToken string `json:"identitytoken,omitempty"`
+}
+
+// dockerConfigFile represents the top-level structure of a docker
+// config.json file: the per-registry auths, the credsStore/credHelpers
+// indirection docker login uses on platforms that keep secrets in an OS
+// keychain instead of writing them to disk, the currentContext selecting
+// an entry from the $DOCKER_CONFIG/contexts store, and any HttpHeaders to
+// attach to every daemon request.
+type dockerConfigFile struct {
+	Auths          map[string]dockerConfig `json:"auths"`
+	CredsStore     string                  `json:"credsStore"`
+	CredHelpers    map[string]string       `json:"credHelpers"`
+	CurrentContext string                  `json:"currentContext"`
+	HttpHeaders    map[string]string       `json:"HttpHeaders"`
 }
 
-// Take the given registry_auth schemas and return a map of registry auth configurations
-func providerSetToRegistryAuth(authSet *schema.Set) (*AuthConfigs, error) {
-	authConfigs := AuthConfigs{
+// Take the given registry_auth schemas and return a map of registry auth
+// configurations, along with a refresher for each registry_auth.credential_helper
+// block so its rotated credentials can be re-resolved later without a
+// full `terraform plan`.
+func providerSetToRegistryAuth(authSet *schema.Set) (*AuthConfigs, []*CredentialHelperRefresher, error) {
+	resolvedAuth := AuthConfigs{
 		Configs: make(map[string]types.AuthConfig),
 	}
+	var refreshers []*CredentialHelperRefresher
 
 	for _, authInt := range authSet.List() {
 		auth := authInt.(map[string]interface{})
 		authConfig := types.AuthConfig{}
 		authConfig.ServerAddress = normalizeRegistryAddress(auth["address"].(string))
 
-		// For each registry_auth block, generate an AuthConfiguration using either
-		// username/password or the given config file
+		// For each registry_auth block, generate an AuthConfiguration using
+		// username/password, an identity/registry token, a credential helper,
+		// or the given config file
 		if username, ok := auth["username"]; ok && username.(string) != "" {
 			authConfig.Username = auth["username"].(string)
 			authConfig.Password = auth["password"].(string)
-		} else if configFile, ok := auth["config_file"]; ok && configFile.(string) != "" {
-			filePath := configFile.(string)
-			if strings.HasPrefix(filePath, "~/") {
-				usr, err := user.Current()
-				if err != nil {
-					return nil, err
-				}
-				filePath = strings.Replace(filePath, "~", usr.HomeDir, 1)
+		} else if identityToken, ok := auth["identity_token"]; ok && identityToken.(string) != "" {
+			authConfig.IdentityToken = identityToken.(string)
+		} else if registryToken, ok := auth["registry_token"]; ok && registryToken.(string) != "" {
+			authConfig.RegistryToken = registryToken.(string)
+		} else if helperBlocks, ok := auth["credential_helper"].([]interface{}); ok && len(helperBlocks) > 0 {
+			spec, err := credentialHelperSpecFromResource(helperBlocks[0].(map[string]interface{}))
+			if err != nil {
+				return nil, nil, err
 			}
 
-			r, err := os.Open(filePath)
+			helperAuth, err := runCredentialHelper(spec, authConfig.ServerAddress)
 			if err != nil {
-				return nil, fmt.Errorf("Error opening docker registry config file: %v", err)
+				return nil, nil, fmt.Errorf("Error resolving registry_auth.credential_helper for %q: %v", authConfig.ServerAddress, err)
+			}
+			authConfig = helperAuth
+			authConfig.ServerAddress = normalizeRegistryAddress(auth["address"].(string))
+
+			refreshers = append(refreshers, &CredentialHelperRefresher{
+				Address:      authConfig.ServerAddress,
+				Spec:         spec,
+				Configs:      &resolvedAuth,
+				lastResolved: time.Now(),
+			})
+		} else if configFile, ok := auth["config_file"]; ok && configFile.(string) != "" {
+			filePath, confFile, err := resolveDockerConfigFile(configFile.(string))
+			if err != nil {
+				return nil, nil, err
 			}
 
-			auths, err := newAuthConfigurations(r)
+			auths, err := authConfigs(confFile)
 			if err != nil {
-				return nil, fmt.Errorf("Error parsing docker registry config json: %v", err)
+				return nil, nil, fmt.Errorf("Error parsing docker registry config json: %v", err)
 			}
 
 			foundRegistry := false
@@ -207,49 +376,85 @@ func providerSetToRegistryAuth(authSet *schema.Set) (*AuthConfigs, error) {
 				if authConfig.ServerAddress == normalizeRegistryAddress(registry) {
 					authConfig.Username = authFileConfig.Username
 					authConfig.Password = authFileConfig.Password
+					authConfig.IdentityToken = authFileConfig.IdentityToken
+					foundRegistry = true
+				}
+			}
+
+			// No inline auth for this registry: fall back to its credsStore/
+			// credHelpers entry, resolved lazily for just this one registry
+			// rather than for every registry listed in the config file.
+			if !foundRegistry && !auth["disable_credential_helpers"].(bool) {
+				if helper := credHelperFor(confFile, authConfig.ServerAddress); helper != "" {
+					helperAuth, err := credentialHelperAuth(helper, authConfig.ServerAddress)
+					if err != nil {
+						return nil, nil, fmt.Errorf("Error resolving credential helper for %q: %v", authConfig.ServerAddress, err)
+					}
+					authConfig.Username = helperAuth.Username
+					authConfig.Password = helperAuth.Password
+					authConfig.IdentityToken = helperAuth.IdentityToken
 					foundRegistry = true
 				}
 			}
 
 			if !foundRegistry {
-				return nil, fmt.Errorf("Couldn't find registry config for '%s' in file: %s",
+				return nil, nil, fmt.Errorf("Couldn't find registry config for '%s' in file: %s",
 					authConfig.ServerAddress, filePath)
 			}
 		}
 
-		authConfigs.Configs[authConfig.ServerAddress] = authConfig
+		resolvedAuth.Configs[authConfig.ServerAddress] = authConfig
 	}
 
-	return &authConfigs, nil
+	return &resolvedAuth, refreshers, nil
 }
 
-// newAuthConfigurations returns AuthConfigs from a JSON encoded string in the
-// same format as the .dockercfg file.
-func newAuthConfigurations(r io.Reader) (*AuthConfigs, error) {
-	var auth *AuthConfigs
-	confs, err := parseDockerConfig(r)
+// resolveDockerConfigFile turns a registry_auth.config_file value into an
+// open, parsed docker config: it expands a leading "~/", treats the path
+// as a $DOCKER_CONFIG-style directory (auto-appending "config.json") when
+// it points at one, and returns the resolved file path alongside the
+// parsed contents.
+func resolveDockerConfigFile(path string) (string, *dockerConfigFile, error) {
+	filePath := path
+	if strings.HasPrefix(filePath, "~/") {
+		usr, err := user.Current()
+		if err != nil {
+			return "", nil, err
+		}
+		filePath = strings.Replace(filePath, "~", usr.HomeDir, 1)
+	}
+
+	if info, err := os.Stat(filePath); err == nil && info.IsDir() {
+		filePath = filepath.Join(filePath, "config.json")
+	}
+
+	r, err := os.Open(filePath)
 	if err != nil {
-		return nil, err
+		return "", nil, fmt.Errorf("Error opening docker registry config file: %v", err)
 	}
-	auth, err = authConfigs(confs)
+	defer r.Close()
+
+	confFile, err := parseDockerConfig(r)
 	if err != nil {
-		return nil, err
+		return "", nil, fmt.Errorf("Error parsing docker registry config json: %v", err)
 	}
-	return auth, nil
+
+	return filePath, confFile, nil
 }
 
-// parseDockerConfig parses the docker config file for auths
-func parseDockerConfig(r io.Reader) (map[string]dockerConfig, error) {
+// parseDockerConfig parses the docker config file for auths, as well as any
+// credsStore/credHelpers indirection used by `docker login` on platforms
+// that store secrets in an OS keychain rather than inline in the file.
+func parseDockerConfig(r io.Reader) (*dockerConfigFile, error) {
 	buf := new(bytes.Buffer)
 	buf.ReadFrom(r)
 	byteData := buf.Bytes()
 
-	confsWrapper := struct {
-		Auths map[string]dockerConfig `json:"auths"`
-	}{}
-	if err := json.Unmarshal(byteData, &confsWrapper); err == nil {
-		if len(confsWrapper.Auths) > 0 {
-			return confsWrapper.Auths, nil
+	var confFile dockerConfigFile
+	if err := json.Unmarshal(byteData, &confFile); err == nil {
+		if len(confFile.Auths) > 0 || confFile.CredsStore != "" || len(confFile.CredHelpers) > 0 ||
+			confFile.CurrentContext != "" || len(confFile.HttpHeaders) > 0 {
+			return &confFile, nil
 		}
 	}
 
@@ -257,15 +462,252 @@ func parseDockerConfig(r io.Reader) (map[string]dockerConfig, error) {
 	if err := json.Unmarshal(byteData, &confs); err != nil {
 		return nil, err
 	}
-	return confs, nil
+	return &dockerConfigFile{Auths: confs}, nil
+}
+
+// credHelperFor returns the docker-credential-helper name that should be
+// used to resolve credentials for the given (already normalized) registry
+// address, preferring a registry-specific credHelpers entry over the
+// file-wide credsStore.
+func credHelperFor(confFile *dockerConfigFile, registry string) string {
+	for reg, helper := range confFile.CredHelpers {
+		if helper != "" && normalizeRegistryAddress(reg) == registry {
+			return helper
+		}
+	}
+	return confFile.CredsStore
+}
+
+// dockerContextEndpoint is the subset of a docker CLI context's "docker"
+// endpoint that the provider can use to drive its own host/TLS config.
+type dockerContextEndpoint struct {
+	Host string
+	Ca   string
+	Cert string
+	Key  string
+}
+
+// dockerContextMeta mirrors the fields the provider needs from
+// contexts/meta/<id>/meta.json in a docker CLI config directory.
+type dockerContextMeta struct {
+	Endpoints map[string]struct {
+		Host string `json:"Host"`
+	} `json:"Endpoints"`
 }
 
-// authConfigs converts a dockerConfigs map to a AuthConfigs object.
-func authConfigs(confs map[string]dockerConfig) (*AuthConfigs, error) {
+// loadDockerContextEndpoint resolves the "docker" endpoint for contextName,
+// reading <dockerConfigDir>/contexts/meta/<id>/meta.json for the host and
+// <dockerConfigDir>/contexts/tls/<id>/docker/{ca,cert,key}.pem for TLS
+// material, where <id> is the hex SHA-256 digest of the context name --
+// the on-disk layout the docker CLI's context store uses.
+func loadDockerContextEndpoint(dockerConfigDir, contextName string) (*dockerContextEndpoint, error) {
+	id := fmt.Sprintf("%x", sha256.Sum256([]byte(contextName)))
+
+	metaPath := filepath.Join(dockerConfigDir, "contexts", "meta", id, "meta.json")
+	metaBytes, err := ioutil.ReadFile(metaPath)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading docker context metadata %s: %v", metaPath, err)
+	}
+
+	var meta dockerContextMeta
+	if err := json.Unmarshal(metaBytes, &meta); err != nil {
+		return nil, fmt.Errorf("Error parsing docker context metadata %s: %v", metaPath, err)
+	}
+
+	endpoint := &dockerContextEndpoint{Host: meta.Endpoints["docker"].Host}
+
+	tlsDir := filepath.Join(dockerConfigDir, "contexts", "tls", id, "docker")
+	if data, err := ioutil.ReadFile(filepath.Join(tlsDir, "ca.pem")); err == nil {
+		endpoint.Ca = string(data)
+	}
+	if data, err := ioutil.ReadFile(filepath.Join(tlsDir, "cert.pem")); err == nil {
+		endpoint.Cert = string(data)
+	}
+	if data, err := ioutil.ReadFile(filepath.Join(tlsDir, "key.pem")); err == nil {
+		endpoint.Key = string(data)
+	}
+
+	return endpoint, nil
+}
+
+// httpHeaderRoundTripper adds a fixed set of headers to every request, used
+// to honor a docker config.json's HttpHeaders setting.
+type httpHeaderRoundTripper struct {
+	headers map[string]string
+	next    http.RoundTripper
+}
+
+func (t *httpHeaderRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	for k, v := range t.headers {
+		req.Header.Set(k, v)
+	}
+	return t.next.RoundTrip(req)
+}
+
+// attachHTTPHeaders wraps the docker client's HTTP transport so every
+// request carries the extra headers from config.json's HttpHeaders field.
+func attachHTTPHeaders(cli *client.Client, headers map[string]string) {
+	httpClient := cli.HTTPClient()
+	next := httpClient.Transport
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	httpClient.Transport = &httpHeaderRoundTripper{headers: headers, next: next}
+}
+
+// credentialHelperSpec describes how to invoke a docker-credential-<name>
+// binary: which one, with what extra arguments/environment, and how often
+// to re-invoke it to pick up rotated credentials (cloud-provider tokens
+// such as ECR's typically expire after a matter of hours).
+type credentialHelperSpec struct {
+	Name            string
+	Args            []string
+	Env             map[string]string
+	RefreshInterval time.Duration
+}
+
+// credentialHelperSpecFromResource builds a credentialHelperSpec from a
+// registry_auth.credential_helper resource block.
+func credentialHelperSpecFromResource(helperBlock map[string]interface{}) (credentialHelperSpec, error) {
+	spec := credentialHelperSpec{
+		Name: helperBlock["name"].(string),
+	}
+
+	for _, a := range helperBlock["args"].([]interface{}) {
+		spec.Args = append(spec.Args, a.(string))
+	}
+
+	if env, ok := helperBlock["env"].(map[string]interface{}); ok && len(env) > 0 {
+		spec.Env = make(map[string]string, len(env))
+		for k, v := range env {
+			spec.Env[k] = v.(string)
+		}
+	}
+
+	if refresh, ok := helperBlock["refresh_interval"].(string); ok && refresh != "" {
+		d, err := time.ParseDuration(refresh)
+		if err != nil {
+			return credentialHelperSpec{}, fmt.Errorf("Error parsing registry_auth.credential_helper.refresh_interval %q: %v", refresh, err)
+		}
+		spec.RefreshInterval = d
+	}
+
+	return spec, nil
+}
+
+// credentialHelperAuth shells out to docker-credential-<helper>, following
+// the protocol at https://github.com/docker/docker-credential-helpers, to
+// resolve the username/secret for a registry whose credentials docker login
+// stored outside of config.json.
+func credentialHelperAuth(helper, registry string) (types.AuthConfig, error) {
+	return runCredentialHelper(credentialHelperSpec{Name: helper}, registry)
+}
+
+// runCredentialHelper invokes docker-credential-<name> get for the given
+// registry, following the standard credential-helper protocol, applying
+// any extra args/env from a registry_auth.credential_helper block.
+func runCredentialHelper(spec credentialHelperSpec, registry string) (types.AuthConfig, error) {
+	binary := "docker-credential-" + spec.Name
+	binaryPath, err := exec.LookPath(binary)
+	if err != nil {
+		return types.AuthConfig{}, fmt.Errorf("credential helper %q not found in PATH: %v", binary, err)
+	}
+
+	cmd := exec.Command(binaryPath, append([]string{"get"}, spec.Args...)...)
+	cmd.Stdin = strings.NewReader(registry)
+	if len(spec.Env) > 0 {
+		cmd.Env = os.Environ()
+		for k, v := range spec.Env {
+			cmd.Env = append(cmd.Env, k+"="+v)
+		}
+	}
+
+	out, err := cmd.Output()
+	if err != nil {
+		return types.AuthConfig{}, fmt.Errorf("%s get %s: %v", binary, registry, err)
+	}
+
+	var resp struct {
+		ServerURL string
+		Username  string
+		Secret    string
+	}
+	if err := json.Unmarshal(out, &resp); err != nil {
+		return types.AuthConfig{}, fmt.Errorf("error parsing %s output: %v", binary, err)
+	}
+
+	authConfig := types.AuthConfig{
+		ServerAddress: registry,
+		Username:      resp.Username,
+	}
+	if resp.Username == "<token>" {
+		authConfig.IdentityToken = resp.Secret
+	} else {
+		authConfig.Password = resp.Secret
+	}
+	return authConfig, nil
+}
+
+// CredentialHelperRefresher re-invokes a registry_auth.credential_helper
+// block to replace a rotated credential (e.g. an ECR token nearing its 12h
+// expiry) in AuthConfigs. It is exposed through
+// ProviderConfig.RefreshCredentialHelpers. No resource calls that method,
+// so resourceDockerImage's pull path uses the credential resolved at
+// configure time; rotated credentials are only picked up by a caller that
+// invokes RefreshCredentialHelpers before each use.
+type CredentialHelperRefresher struct {
+	Address      string
+	Spec         credentialHelperSpec
+	Configs      *AuthConfigs
+	lastResolved time.Time
+}
+
+// Refresh re-invokes the credential helper if RefreshInterval has elapsed
+// since the credential was last resolved, replacing the cached AuthConfig
+// in place. It is a no-op if RefreshInterval is zero.
+func (r *CredentialHelperRefresher) Refresh() error {
+	if r.Spec.RefreshInterval <= 0 || time.Since(r.lastResolved) < r.Spec.RefreshInterval {
+		return nil
+	}
+
+	authConfig, err := runCredentialHelper(r.Spec, r.Address)
+	if err != nil {
+		return fmt.Errorf("Error refreshing registry_auth.credential_helper for %q: %v", r.Address, err)
+	}
+
+	r.Configs.Configs[r.Address] = authConfig
+	r.lastResolved = time.Now()
+	return nil
+}
+
+// RefreshCredentialHelpers re-invokes every registry_auth.credential_helper
+// block that set a refresh_interval, replacing any credential whose
+// interval has elapsed. Callers that need the freshest credentials for a
+// long-running apply (e.g. before a docker_image pull) should call this
+// first.
+func (p *ProviderConfig) RefreshCredentialHelpers() error {
+	for _, r := range p.CredentialHelperRefreshers {
+		if err := r.Refresh(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// authConfigs converts a dockerConfigFile's inline auths entries to an
+// AuthConfigs object. Entries with no inline auth (credsStore/credHelpers
+// only) are left out rather than resolved here: resolving a credential
+// helper shells out to an external binary, and doing that for every
+// registry in the file -- most of which registry_auth never asks about --
+// would make providerConfigure fail on an unrelated registry's broken
+// helper. Callers resolve those lazily, one registry at a time, via
+// credHelperFor/credentialHelperAuth once they know which registry they
+// actually need.
+func authConfigs(confFile *dockerConfigFile) (*AuthConfigs, error) {
 	c := &AuthConfigs{
 		Configs: make(map[string]types.AuthConfig),
 	}
-	for reg, conf := range confs {
+	for reg, conf := range confFile.Auths {
 		if conf.Auth == "" {
 			continue
 		}
@@ -283,36 +725,93 @@ func authConfigs(confs map[string]dockerConfig) (*AuthConfigs, error) {
 			Password:      userpass[1],
 			ServerAddress: reg,
 			Auth:          conf.Auth,
+			IdentityToken: conf.IdentityToken,
 		}
 	}
+
 	return c, nil
 }
 
-// TODO
-// AuthCheck validates the given credentials. It returns nil if successful.
-//
-// For Docker API versions >= 1.23, the AuthStatus struct will be populated, otherwise it will be empty.`
-//
-// See https://goo.gl/6nsZkH for more details.
-// func (c *Client) AuthCheck(conf *AuthConfiguration) (AuthStatus, error) {
-// 	var authStatus AuthStatus
-// 	if conf == nil {
-// 		return authStatus, errors.New("conf is nil")
-// 	}
-// 	resp, err := c.do("POST", "/auth", doOptions{data: conf})
-// 	if err != nil {
-// 		return authStatus, err
-// 	}
-// 	defer resp.Body.Close()
-// 	data, err := ioutil.ReadAll(resp.Body)
-// 	if err != nil {
-// 		return authStatus, err
-// 	}
-// 	if len(data) == 0 {
-// 		return authStatus, nil
-// 	}
-// 	if err := json.Unmarshal(data, &authStatus); err != nil {
-// 		return authStatus, err
-// 	}
-// 	return authStatus, nil
-// }
+// registryAuthFailure records one registry_auth entry that failed
+// authentication during AuthCheck.
+type registryAuthFailure struct {
+	Address    string
+	StatusCode int
+	Err        error
+}
+
+// registryAuthStatusCode maps a RegistryLogin error to the HTTP status the
+// daemon responded with, using the errdefs classification the docker client
+// already attaches to its errors, rather than parsing error text.
+func registryAuthStatusCode(err error) int {
+	switch {
+	case errdefs.IsUnauthorized(err):
+		return http.StatusUnauthorized
+	case errdefs.IsForbidden(err):
+		return http.StatusForbidden
+	case errdefs.IsNotFound(err):
+		return http.StatusNotFound
+	case errdefs.IsInvalidParameter(err):
+		return http.StatusBadRequest
+	case errdefs.IsUnavailable(err):
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// authCheckError is returned by AuthCheck when one or more registry_auth
+// entries fail to authenticate. It lists every failing registry so
+// Terraform can report all of them at once, rather than stopping at the
+// first one.
+type authCheckError struct {
+	Failures []registryAuthFailure
+}
+
+func (e *authCheckError) Error() string {
+	var b strings.Builder
+	b.WriteString("Error validating registry credentials:")
+	for _, f := range e.Failures {
+		fmt.Fprintf(&b, "\n  %s (HTTP %d): %s", f.Address, f.StatusCode, f.Err)
+	}
+	return b.String()
+}
+
+// AuthCheck validates every configured registry_auth entry against the
+// daemon's /auth endpoint via RegistryLogin, so that bad credentials are
+// caught at `terraform plan` instead of later during a docker_image apply.
+// Any IdentityToken the registry returns is written back into authConfigs
+// so subsequent pulls/pushes reuse it instead of the original password.
+func AuthCheck(ctx context.Context, cli *client.Client, authConfigs *AuthConfigs) error {
+	var failures []registryAuthFailure
+
+	for address, authConfig := range authConfigs.Configs {
+		if authConfig.RegistryToken != "" {
+			// RegistryToken is forwarded as a bearer token via X-Registry-Auth
+			// on the push/pull request itself, bypassing /auth entirely, so
+			// there's nothing for RegistryLogin to validate here.
+			continue
+		}
+
+		resp, err := cli.RegistryLogin(ctx, authConfig)
+		if err != nil {
+			failures = append(failures, registryAuthFailure{
+				Address:    address,
+				StatusCode: registryAuthStatusCode(err),
+				Err:        err,
+			})
+			continue
+		}
+
+		if resp.IdentityToken != "" {
+			authConfig.IdentityToken = resp.IdentityToken
+			authConfigs.Configs[address] = authConfig
+		}
+	}
+
+	if len(failures) > 0 {
+		return &authCheckError{Failures: failures}
+	}
+
+	return nil
+}
@@ -0,0 +1,331 @@
+package docker
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/errdefs"
+)
+
+// writeFakeCredentialHelper drops a docker-credential-<name> script on PATH
+// that implements just enough of the credential-helper protocol for tests:
+// it ignores stdin and prints a fixed ServerURL/Username/Secret response,
+// restoring the original PATH when the test completes.
+func writeFakeCredentialHelper(t *testing.T, name, username, secret string) {
+	t.Helper()
+
+	dir := t.TempDir()
+	script := fmt.Sprintf("#!/bin/sh\ncat >/dev/null\necho '{\"ServerURL\":\"\",\"Username\":%q,\"Secret\":%q}'\n", username, secret)
+	path := filepath.Join(dir, "docker-credential-"+name)
+	if err := os.WriteFile(path, []byte(script), 0755); err != nil {
+		t.Fatalf("writing fake credential helper: %v", err)
+	}
+
+	oldPath := os.Getenv("PATH")
+	os.Setenv("PATH", dir+string(os.PathListSeparator)+oldPath)
+	t.Cleanup(func() { os.Setenv("PATH", oldPath) })
+}
+
+func TestParseDockerConfig(t *testing.T) {
+	cases := []struct {
+		name string
+		json string
+		want dockerConfigFile
+	}{
+		{
+			name: "inline auths",
+			json: `{"auths":{"registry.example.com":{"auth":"dXNlcjpwYXNz"}}}`,
+			want: dockerConfigFile{
+				Auths: map[string]dockerConfig{
+					"registry.example.com": {Auth: "dXNlcjpwYXNz"},
+				},
+			},
+		},
+		{
+			name: "credsStore only, no inline auths",
+			json: `{"auths":{},"credsStore":"osxkeychain"}`,
+			want: dockerConfigFile{Auths: map[string]dockerConfig{}, CredsStore: "osxkeychain"},
+		},
+		{
+			name: "credHelpers only, no inline auths",
+			json: `{"auths":{},"credHelpers":{"123456789.dkr.ecr.us-east-1.amazonaws.com":"ecr-login"}}`,
+			want: dockerConfigFile{
+				Auths:       map[string]dockerConfig{},
+				CredHelpers: map[string]string{"123456789.dkr.ecr.us-east-1.amazonaws.com": "ecr-login"},
+			},
+		},
+		{
+			// A real, unmodified Docker Desktop config.json: no credsStore/
+			// credHelpers at all, just a currentContext selecting a context
+			// whose endpoint the provider should resolve.
+			name: "currentContext only, no inline auths",
+			json: `{"auths":{},"currentContext":"desktop-linux"}`,
+			want: dockerConfigFile{Auths: map[string]dockerConfig{}, CurrentContext: "desktop-linux"},
+		},
+		{
+			name: "HttpHeaders only, no inline auths",
+			json: `{"auths":{},"HttpHeaders":{"User-Agent":"my-client/1.0"}}`,
+			want: dockerConfigFile{
+				Auths:       map[string]dockerConfig{},
+				HttpHeaders: map[string]string{"User-Agent": "my-client/1.0"},
+			},
+		},
+		{
+			// The legacy .dockercfg format: a bare map of registry to auth
+			// entry, with no "auths" wrapper key at all.
+			name: "legacy bare map",
+			json: `{"registry.example.com":{"auth":"dXNlcjpwYXNz"}}`,
+			want: dockerConfigFile{
+				Auths: map[string]dockerConfig{
+					"registry.example.com": {Auth: "dXNlcjpwYXNz"},
+				},
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := parseDockerConfig(strings.NewReader(c.json))
+			if err != nil {
+				t.Fatalf("parseDockerConfig() error = %v", err)
+			}
+
+			if got.CredsStore != c.want.CredsStore {
+				t.Errorf("CredsStore = %q, want %q", got.CredsStore, c.want.CredsStore)
+			}
+			if got.CurrentContext != c.want.CurrentContext {
+				t.Errorf("CurrentContext = %q, want %q", got.CurrentContext, c.want.CurrentContext)
+			}
+			if len(got.Auths) != len(c.want.Auths) {
+				t.Errorf("Auths = %v, want %v", got.Auths, c.want.Auths)
+			}
+			for reg, conf := range c.want.Auths {
+				if got.Auths[reg] != conf {
+					t.Errorf("Auths[%q] = %v, want %v", reg, got.Auths[reg], conf)
+				}
+			}
+			for reg, helper := range c.want.CredHelpers {
+				if got.CredHelpers[reg] != helper {
+					t.Errorf("CredHelpers[%q] = %q, want %q", reg, got.CredHelpers[reg], helper)
+				}
+			}
+			for k, v := range c.want.HttpHeaders {
+				if got.HttpHeaders[k] != v {
+					t.Errorf("HttpHeaders[%q] = %q, want %q", k, got.HttpHeaders[k], v)
+				}
+			}
+		})
+	}
+}
+
+func TestCredHelperFor(t *testing.T) {
+	confFile := &dockerConfigFile{
+		CredsStore: "osxkeychain",
+		CredHelpers: map[string]string{
+			"123456789.dkr.ecr.us-east-1.amazonaws.com": "ecr-login",
+		},
+	}
+
+	cases := []struct {
+		name     string
+		registry string
+		want     string
+	}{
+		{
+			name:     "registry-specific credHelpers entry wins over credsStore",
+			registry: normalizeRegistryAddress("123456789.dkr.ecr.us-east-1.amazonaws.com"),
+			want:     "ecr-login",
+		},
+		{
+			name:     "URL-form registry address still matches bare credHelpers key once normalized",
+			registry: normalizeRegistryAddress("https://123456789.dkr.ecr.us-east-1.amazonaws.com/"),
+			want:     "ecr-login",
+		},
+		{
+			name:     "falls back to file-wide credsStore",
+			registry: normalizeRegistryAddress("registry.example.com"),
+			want:     "osxkeychain",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := credHelperFor(confFile, c.registry); got != c.want {
+				t.Errorf("credHelperFor() = %q, want %q", got, c.want)
+			}
+		})
+	}
+}
+
+func TestRegistryAuthStatusCode(t *testing.T) {
+	base := errors.New("login attempt failed")
+
+	cases := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{name: "unauthorized", err: errdefs.Unauthorized(base), want: http.StatusUnauthorized},
+		{name: "forbidden", err: errdefs.Forbidden(base), want: http.StatusForbidden},
+		{name: "not found", err: errdefs.NotFound(base), want: http.StatusNotFound},
+		{name: "invalid parameter", err: errdefs.InvalidParameter(base), want: http.StatusBadRequest},
+		{name: "unavailable", err: errdefs.Unavailable(base), want: http.StatusServiceUnavailable},
+		{name: "unclassified error falls back to internal server error", err: base, want: http.StatusInternalServerError},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := registryAuthStatusCode(c.err); got != c.want {
+				t.Errorf("registryAuthStatusCode() = %d, want %d", got, c.want)
+			}
+		})
+	}
+}
+
+func TestRunCredentialHelper(t *testing.T) {
+	t.Run("username and password", func(t *testing.T) {
+		writeFakeCredentialHelper(t, "faketest", "alice", "s3cr3t")
+
+		authConfig, err := runCredentialHelper(credentialHelperSpec{Name: "faketest"}, "registry.example.com")
+		if err != nil {
+			t.Fatalf("runCredentialHelper() error = %v", err)
+		}
+		if authConfig.Username != "alice" || authConfig.Password != "s3cr3t" || authConfig.IdentityToken != "" {
+			t.Errorf("runCredentialHelper() = %+v, want Username=alice Password=s3cr3t IdentityToken=\"\"", authConfig)
+		}
+	})
+
+	t.Run("<token> sentinel maps Secret to IdentityToken", func(t *testing.T) {
+		writeFakeCredentialHelper(t, "faketest", "<token>", "tok123")
+
+		authConfig, err := runCredentialHelper(credentialHelperSpec{Name: "faketest"}, "registry.example.com")
+		if err != nil {
+			t.Fatalf("runCredentialHelper() error = %v", err)
+		}
+		if authConfig.IdentityToken != "tok123" || authConfig.Password != "" {
+			t.Errorf("runCredentialHelper() = %+v, want IdentityToken=tok123 Password=\"\"", authConfig)
+		}
+	})
+
+	t.Run("helper not found in PATH", func(t *testing.T) {
+		if _, err := runCredentialHelper(credentialHelperSpec{Name: "does-not-exist"}, "registry.example.com"); err == nil {
+			t.Error("runCredentialHelper() error = nil, want error for missing helper binary")
+		}
+	})
+}
+
+func TestCredentialHelperRefresherRefresh(t *testing.T) {
+	t.Run("no-op when RefreshInterval is zero", func(t *testing.T) {
+		writeFakeCredentialHelper(t, "faketest", "alice", "first-secret")
+		configs := &AuthConfigs{Configs: map[string]types.AuthConfig{
+			"registry.example.com": {Username: "alice", Password: "first-secret"},
+		}}
+		r := &CredentialHelperRefresher{
+			Address:      "registry.example.com",
+			Spec:         credentialHelperSpec{Name: "faketest"},
+			Configs:      configs,
+			lastResolved: time.Now().Add(-24 * time.Hour),
+		}
+
+		if err := r.Refresh(); err != nil {
+			t.Fatalf("Refresh() error = %v", err)
+		}
+		if got := configs.Configs["registry.example.com"].Password; got != "first-secret" {
+			t.Errorf("Password = %q, want unchanged %q", got, "first-secret")
+		}
+	})
+
+	t.Run("no-op before RefreshInterval has elapsed", func(t *testing.T) {
+		writeFakeCredentialHelper(t, "faketest", "alice", "first-secret")
+		configs := &AuthConfigs{Configs: map[string]types.AuthConfig{
+			"registry.example.com": {Username: "alice", Password: "first-secret"},
+		}}
+		r := &CredentialHelperRefresher{
+			Address:      "registry.example.com",
+			Spec:         credentialHelperSpec{Name: "faketest", RefreshInterval: time.Hour},
+			Configs:      configs,
+			lastResolved: time.Now(),
+		}
+
+		if err := r.Refresh(); err != nil {
+			t.Fatalf("Refresh() error = %v", err)
+		}
+		if got := configs.Configs["registry.example.com"].Password; got != "first-secret" {
+			t.Errorf("Password = %q, want unchanged %q", got, "first-secret")
+		}
+	})
+
+	t.Run("re-invokes helper once RefreshInterval has elapsed", func(t *testing.T) {
+		writeFakeCredentialHelper(t, "faketest", "alice", "rotated-secret")
+		configs := &AuthConfigs{Configs: map[string]types.AuthConfig{
+			"registry.example.com": {Username: "alice", Password: "first-secret"},
+		}}
+		r := &CredentialHelperRefresher{
+			Address:      "registry.example.com",
+			Spec:         credentialHelperSpec{Name: "faketest", RefreshInterval: time.Hour},
+			Configs:      configs,
+			lastResolved: time.Now().Add(-2 * time.Hour),
+		}
+
+		if err := r.Refresh(); err != nil {
+			t.Fatalf("Refresh() error = %v", err)
+		}
+		if got := configs.Configs["registry.example.com"].Password; got != "rotated-secret" {
+			t.Errorf("Password = %q, want rotated %q", got, "rotated-secret")
+		}
+		if time.Since(r.lastResolved) > time.Minute {
+			t.Errorf("lastResolved was not updated to a recent time")
+		}
+	})
+}
+
+func TestLoadDockerContextEndpoint(t *testing.T) {
+	dockerConfigDir := t.TempDir()
+	contextName := "desktop-linux"
+	id := fmt.Sprintf("%x", sha256.Sum256([]byte(contextName)))
+
+	metaDir := filepath.Join(dockerConfigDir, "contexts", "meta", id)
+	if err := os.MkdirAll(metaDir, 0755); err != nil {
+		t.Fatalf("creating context meta dir: %v", err)
+	}
+	meta := `{"Endpoints":{"docker":{"Host":"unix:///home/user/.docker/run/docker.sock"}}}`
+	if err := os.WriteFile(filepath.Join(metaDir, "meta.json"), []byte(meta), 0644); err != nil {
+		t.Fatalf("writing context meta.json: %v", err)
+	}
+
+	tlsDir := filepath.Join(dockerConfigDir, "contexts", "tls", id, "docker")
+	if err := os.MkdirAll(tlsDir, 0755); err != nil {
+		t.Fatalf("creating context tls dir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(tlsDir, "ca.pem"), []byte("fake-ca"), 0644); err != nil {
+		t.Fatalf("writing ca.pem: %v", err)
+	}
+
+	endpoint, err := loadDockerContextEndpoint(dockerConfigDir, contextName)
+	if err != nil {
+		t.Fatalf("loadDockerContextEndpoint() error = %v", err)
+	}
+	if endpoint.Host != "unix:///home/user/.docker/run/docker.sock" {
+		t.Errorf("Host = %q, want %q", endpoint.Host, "unix:///home/user/.docker/run/docker.sock")
+	}
+	if endpoint.Ca != "fake-ca" {
+		t.Errorf("Ca = %q, want %q", endpoint.Ca, "fake-ca")
+	}
+	if endpoint.Cert != "" || endpoint.Key != "" {
+		t.Errorf("Cert/Key = %q/%q, want empty (no cert.pem/key.pem written)", endpoint.Cert, endpoint.Key)
+	}
+
+	t.Run("unknown context", func(t *testing.T) {
+		if _, err := loadDockerContextEndpoint(dockerConfigDir, "no-such-context"); err == nil {
+			t.Error("loadDockerContextEndpoint() error = nil, want error for missing context metadata")
+		}
+	})
+}